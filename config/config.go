@@ -0,0 +1,37 @@
+package config
+
+import "sync"
+
+var (
+	mu      sync.RWMutex
+	_config *Configuration
+)
+
+// Configuration is the root of Wings' config.yml structure.
+type Configuration struct {
+	Docker DockerConfiguration `yaml:"docker"`
+}
+
+// Get returns the currently active configuration. Every package that reads
+// configuration assumes Wings has already loaded config.yml (or, in tests,
+// called Set) during startup.
+func Get() *Configuration {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if _config == nil {
+		panic("config: Get() called before the configuration was loaded")
+	}
+
+	return _config
+}
+
+// Set installs c as the active configuration, replacing whatever was loaded
+// previously. Outside of tests this is normally only called once, during
+// Wings startup after config.yml has been parsed.
+func Set(c *Configuration) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_config = c
+}
@@ -0,0 +1,7 @@
+package config
+
+// DockerConfiguration controls how Wings talks to the Docker daemon,
+// including the networking behavior applied to every server container.
+type DockerConfiguration struct {
+	Network NetworkConfiguration `yaml:"network"`
+}
@@ -0,0 +1,62 @@
+package config
+
+// NetworkConfiguration controls how server containers are attached to the
+// network, and how their allocated ports are resolved into Docker bindings
+// before a container is created.
+type NetworkConfiguration struct {
+	// Interface is the pelican0 bridge's host-side IP. It's used to rewrite
+	// 127.0.0.1 allocations so they're reachable from outside the container.
+	Interface string `yaml:"interface" default:"172.18.0.1"`
+	// ISPN drops a 127.0.0.1 allocation entirely instead of rewriting it,
+	// for setups where the host loopback address isn't reachable from other
+	// containers at all.
+	ISPN bool `yaml:"ispn" default:"false"`
+
+	// IPv4Enabled and IPv6Enabled control which IP families Bindings() binds
+	// allocations to. Both default to true; an operator who wants IPv4-only
+	// or IPv6-only must explicitly set the other to false, since leaving both
+	// unset is what every config predating this option has, and should keep
+	// behaving the way it always did.
+	IPv4Enabled bool `yaml:"ipv4_enabled" default:"true"`
+	IPv6Enabled bool `yaml:"ipv6_enabled" default:"true"`
+
+	// HostBindingPolicy controls how DockerBindings() treats a Mappings
+	// entry's host IP; see environment.HostBindingPolicy for the accepted
+	// values. It's a plain string here (rather than environment's own type)
+	// so this package doesn't have to import environment, which would create
+	// an import cycle since environment already imports config.
+	HostBindingPolicy string `yaml:"host_binding_policy" default:"rewrite_loopback_to_interface"`
+	// HostBindingAllowlist is the set of host IPs permitted when
+	// HostBindingPolicy is "allowlist".
+	HostBindingAllowlist []string `yaml:"host_binding_allowlist"`
+
+	// DynamicPortPool is the inclusive port range Wings draws from to satisfy
+	// a "dynamic" Mappings entry, mirroring Docker's historical
+	// portRangeStart/portRangeEnd allocator.
+	DynamicPortPool DynamicPortPoolConfiguration `yaml:"dynamic_port_pool"`
+
+	// Interfaces carries the configured subnets for the pelican0 network,
+	// used to validate an Allocations.IPAM address actually falls within it.
+	Interfaces NetworkInterfacesConfiguration `yaml:"interfaces"`
+}
+
+// DynamicPortPoolConfiguration is the inclusive port range "dynamic" Mappings
+// entries are drawn from.
+type DynamicPortPoolConfiguration struct {
+	Start int `yaml:"start" default:"25565"`
+	End   int `yaml:"end" default:"25665"`
+}
+
+// NetworkInterfacesConfiguration carries the configured IPv4/IPv6 subnets for
+// the pelican0 network.
+type NetworkInterfacesConfiguration struct {
+	V4 SubnetConfiguration `yaml:"v4"`
+	V6 SubnetConfiguration `yaml:"v6"`
+}
+
+// SubnetConfiguration is a single IP family's CIDR subnet for pelican0.
+// Subnet is empty when pelican0 is using Docker's default IPAM driver rather
+// than a fixed subnet.
+type SubnetConfiguration struct {
+	Subnet string `yaml:"subnet"`
+}
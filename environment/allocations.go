@@ -1,14 +1,177 @@
 package environment
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"regexp"
 	"strconv"
 
+	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 
 	"github.com/pelican-dev/wings/config"
 )
 
+// Protocol represents the transport protocol(s) a given port mapping should be
+// published for.
+type Protocol string
+
+const (
+	ProtocolTCP  Protocol = "tcp"
+	ProtocolUDP  Protocol = "udp"
+	ProtocolBoth Protocol = "both"
+)
+
+// HostIPFamily controls which IP family (or both) a port mapping is bound to on
+// the host. "dual" preserves the historical behavior of binding only the IPv6
+// wildcard address, which Linux also accepts IPv4 connections on unless
+// net.ipv6.bindv6only has been set.
+type HostIPFamily string
+
+const (
+	HostIPFamilyV4   HostIPFamily = "v4"
+	HostIPFamilyV6   HostIPFamily = "v6"
+	HostIPFamilyDual HostIPFamily = "dual"
+)
+
+// DynamicPortRequest asks Wings to pick free ports out of the configured
+// docker.network.dynamic_port_pool rather than the panel enumerating them
+// up front.
+type DynamicPortRequest struct {
+	Protocol Protocol `json:"proto"`
+	Count    int      `json:"count"`
+}
+
+// portRangePattern matches the "START-END/proto" and "PORT/proto" string forms
+// of a port mapping entry, with the range and protocol both optional.
+var portRangePattern = regexp.MustCompile(`^(\d+)(?:-(\d+))?(?:/(tcp|udp|both))?$`)
+
+// PortMapping represents a single port allocation entry, which may be a single
+// port, a contiguous range, or a request for Wings to assign ports
+// dynamically out of a pool. It can be unmarshaled from:
+//
+//   - a bare integer, the legacy format the panel has always sent
+//   - a string such as "25565" or "25565-25600/udp"
+//   - an object carrying explicit protocol and host-IP-family overrides, a
+//     "range": [start, end] pair, or a "dynamic": {...} request
+//
+// In every case the zero value defaults to the historical behavior (both
+// protocols, dual stack bound to the IPv6 wildcard) so existing panel
+// installations don't need to change anything to keep working.
+type PortMapping struct {
+	Port         int                 `json:"port"`
+	RangeEnd     int                 `json:"-"`
+	Protocol     Protocol            `json:"protocol,omitempty"`
+	HostIPFamily HostIPFamily        `json:"host_ip_family,omitempty"`
+	Dynamic      *DynamicPortRequest `json:"-"`
+}
+
+// IsRange reports whether this entry spans more than a single port.
+func (p *PortMapping) IsRange() bool {
+	return p.RangeEnd > p.Port
+}
+
+// UnmarshalJSON allows a PortMapping to be populated from a bare integer, a
+// "port[-end][/proto]" string, or a full object, so the "mappings" field in
+// the allocation payload can mix the legacy format with the extended ones.
+func (p *PortMapping) UnmarshalJSON(data []byte) error {
+	var port int
+	if err := json.Unmarshal(data, &port); err == nil {
+		p.Port = port
+		p.RangeEnd = port
+		p.Protocol = ProtocolBoth
+		p.HostIPFamily = HostIPFamilyDual
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		m := portRangePattern.FindStringSubmatch(str)
+		if m == nil {
+			return fmt.Errorf("environment: invalid port mapping string %q", str)
+		}
+
+		start, _ := strconv.Atoi(m[1])
+		p.Port = start
+		p.RangeEnd = start
+		if m[2] != "" {
+			end, _ := strconv.Atoi(m[2])
+			p.RangeEnd = end
+		}
+		p.Protocol = ProtocolBoth
+		if m[3] != "" {
+			p.Protocol = Protocol(m[3])
+		}
+		p.HostIPFamily = HostIPFamilyDual
+		if err := p.validateRange(); err != nil {
+			return fmt.Errorf("environment: invalid port mapping string %q: %w", str, err)
+		}
+		return nil
+	}
+
+	var raw struct {
+		Port         int                 `json:"port"`
+		Range        []int               `json:"range"`
+		Protocol     Protocol            `json:"protocol"`
+		Proto        Protocol            `json:"proto"`
+		HostIPFamily HostIPFamily        `json:"host_ip_family"`
+		Dynamic      *DynamicPortRequest `json:"dynamic"`
+	}
+	raw.Protocol = ProtocolBoth
+	raw.HostIPFamily = HostIPFamilyDual
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("environment: invalid port mapping entry: %w", err)
+	}
+
+	if raw.Proto != "" {
+		raw.Protocol = raw.Proto
+	}
+
+	if raw.Dynamic != nil {
+		if raw.Dynamic.Protocol == "" {
+			raw.Dynamic.Protocol = ProtocolBoth
+		}
+		p.Dynamic = raw.Dynamic
+		p.Protocol = raw.Protocol
+		p.HostIPFamily = raw.HostIPFamily
+		return nil
+	}
+
+	p.Port = raw.Port
+	p.RangeEnd = raw.Port
+	if len(raw.Range) == 2 {
+		p.Port = raw.Range[0]
+		p.RangeEnd = raw.Range[1]
+	}
+	p.Protocol = raw.Protocol
+	p.HostIPFamily = raw.HostIPFamily
+
+	if err := p.validateRange(); err != nil {
+		return fmt.Errorf("environment: invalid port mapping entry: %w", err)
+	}
+
+	return nil
+}
+
+// validateRange rejects a port (or range) that is out of the valid TCP/UDP
+// port space, or whose end comes before its start, instead of letting it
+// through to be silently clamped or skipped later.
+func (p *PortMapping) validateRange() error {
+	if p.Port < 1 || p.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", p.Port)
+	}
+	if p.RangeEnd < 1 || p.RangeEnd > 65535 {
+		return fmt.Errorf("range end %d is out of range", p.RangeEnd)
+	}
+	if p.RangeEnd < p.Port {
+		return fmt.Errorf("range end %d comes before range start %d", p.RangeEnd, p.Port)
+	}
+
+	return nil
+}
+
 // Defines the allocations available for a given server. When using the Docker environment
 // driver these correspond to mappings for the container that allow external connections.
 type Allocations struct {
@@ -17,6 +180,15 @@ type Allocations struct {
 	// the DefaultMapping's IP. This is important to servers which rely on external
 	// services that check the IP of the server (Source Engine servers, for example).
 	ForceOutgoingIP bool `json:"force_outgoing_ip"`
+	// NetworkMode selects how the container is attached to the network stack.
+	// It defaults to NetworkModeBridge, in which case Mappings is published as
+	// normal; for host, none, and container:<uuid> modes Bindings() and
+	// Exposed() return empty maps since port publishing is meaningless (or, in
+	// the container case, owned by the server being shared with).
+	NetworkMode NetworkMode `json:"network_mode,omitempty"`
+	// IPAM optionally pins this server to a stable address (or addresses) on
+	// the pelican0 network instead of letting Docker's allocator pick one.
+	IPAM IPAM `json:"ipam,omitempty"`
 	// Defines the default allocation that should be used for this server. This is
 	// what will be used for {SERVER_IP} and {SERVER_PORT} when modifying configuration
 	// files or the startup arguments for a server.
@@ -26,8 +198,42 @@ type Allocations struct {
 	} `json:"default"`
 
 	// Mappings contains all the ports that should be assigned to a given server
-	// attached to the IP they correspond to.
-	Mappings map[string][]int `json:"mappings"`
+	// attached to the IP they correspond to. Each entry defaults to the
+	// historical "both protocols, dual stack" behavior unless the panel
+	// specifies otherwise.
+	Mappings map[string][]PortMapping `json:"mappings"`
+}
+
+// bindFamilies resolves whether a mapping entry should be bound on the IPv4
+// side (using the allocation's own host IP), the IPv6 side (the wildcard
+// address), or both, combining the entry's own HostIPFamily with the
+// configured docker.network.ipv4_enabled/ipv6_enabled toggles. It's factored
+// out of the per-port loop in Bindings() since it only depends on the
+// mapping, not the port, and config.Get() isn't free to call thousands of
+// times over a large range.
+func bindFamilies(mapping PortMapping) (wantV4, wantV6 bool) {
+	ipv4Enabled, ipv6Enabled := ipFamilyDefaults()
+
+	wantV4 = ipv4Enabled && (mapping.HostIPFamily == HostIPFamilyV4 || mapping.HostIPFamily == HostIPFamilyDual || mapping.HostIPFamily == "")
+	wantV6 = ipv6Enabled && (mapping.HostIPFamily == HostIPFamilyV6 || mapping.HostIPFamily == HostIPFamilyDual || mapping.HostIPFamily == "")
+
+	return wantV4, wantV6
+}
+
+// ipFamilyDefaults resolves docker.network.ipv4_enabled/ipv6_enabled, treating
+// the case where neither has been set (the zero value for both, which is what
+// every config predating this option has) as "both enabled" so upgrading
+// Wings doesn't silently drop every server's port bindings. An operator who
+// genuinely wants IPv4-only or IPv6-only must explicitly enable one of the
+// two; as soon as either is explicitly true we stop applying the fallback.
+func ipFamilyDefaults() (ipv4Enabled, ipv6Enabled bool) {
+	netCfg := config.Get().Docker.Network
+
+	if !netCfg.IPv4Enabled && !netCfg.IPv6Enabled {
+		return true, true
+	}
+
+	return netCfg.IPv4Enabled, netCfg.IPv6Enabled
 }
 
 // Converts the server allocation mappings into a format that can be understood by Docker. While
@@ -35,70 +241,177 @@ type Allocations struct {
 // bindings certainly makes life a little easier for managing things.
 //
 // You'll want to use DockerBindings() if you need to re-map 127.0.0.1 to the Docker interface.
+//
+// Range entries are expanded here rather than earlier, since the Docker Engine API has no way to
+// express a host-port range for a single container port: HostConfig.PortBindings is keyed by one
+// container port at a time, so a 1:1 range still needs one nat.Port entry per port no matter how
+// it's represented in memory beforehand. What we avoid is redoing the protocol/host-IP-family
+// resolution (which hits config.Get()) on every single port in the range — that's resolved once
+// per mapping entry via bindFamilies, outside the port loop, so a several-thousand-port range for
+// something like a Bedrock proxy is a tight loop over cheap string formatting rather than redoing
+// the same lookups and comparisons thousands of times over.
+//
+// Dynamic entries are skipped entirely; they must be resolved to concrete ports with
+// ResolveDynamic before Bindings() is called, since picking the ports requires access to the
+// configured pool and the server's persisted state.
 func (a *Allocations) Bindings() nat.PortMap {
-	out := nat.PortMap{}
+	out := make(nat.PortMap, len(a.Mappings))
 
-	for _, ports := range a.Mappings {
-		for _, port := range ports {
-			// Skip over invalid ports.
-			if port < 1 || port > 65535 {
+	if !a.NetworkMode.publishesPorts() {
+		return out
+	}
+
+	for ip, mappings := range a.Mappings {
+		for _, mapping := range mappings {
+			if mapping.Dynamic != nil {
 				continue
 			}
 
-			// Create the primary IPv4 binding with address 0.0.0.0 for both TCP and UDP.
-			// ipv4Binding := nat.PortBinding{
-			// 	HostIP:   ip,
-			// 	HostPort: strconv.Itoa(port),
-			// }
-
-			// Create the additional IPv6 binding with address [::] for both TCP and UDP.
-			ipv6Binding := nat.PortBinding{
-				HostIP:   "[::]",
-				HostPort: strconv.Itoa(port),
+			// Skip over anything that didn't pass validateRange (e.g. because
+			// it was constructed directly rather than unmarshaled from JSON).
+			if err := mapping.validateRange(); err != nil {
+				continue
 			}
 
-			// Define the TCP and UDP ports using the current port number.
-			tcpPort := nat.Port(fmt.Sprintf("%d/tcp", port))
-			udpPort := nat.Port(fmt.Sprintf("%d/udp", port))
+			wantV4, wantV6 := bindFamilies(mapping)
+			if !wantV4 && !wantV6 {
+				continue
+			}
+			// A dual-stack entry with both families enabled keeps the historical
+			// single [::] binding, which also accepts IPv4 connections.
+			if wantV4 && wantV6 && (mapping.HostIPFamily == HostIPFamilyDual || mapping.HostIPFamily == "") {
+				wantV4 = false
+			}
 
-			// Append the IPv4 binding for TCP and UDP.
-			// out[tcpPort] = append(out[tcpPort], ipv4Binding)
-			// out[udpPort] = append(out[udpPort], ipv4Binding)
+			wantTCP := mapping.Protocol == ProtocolTCP || mapping.Protocol == ProtocolBoth || mapping.Protocol == ""
+			wantUDP := mapping.Protocol == ProtocolUDP || mapping.Protocol == ProtocolBoth || mapping.Protocol == ""
 
-			// Append the IPv6 binding for TCP and UDP.
-			out[tcpPort] = append(out[tcpPort], ipv6Binding)
-			out[udpPort] = append(out[udpPort], ipv6Binding)
+			for port := mapping.Port; port <= mapping.RangeEnd; port++ {
+				var binds []nat.PortBinding
+				if wantV4 {
+					binds = append(binds, nat.PortBinding{HostIP: ip, HostPort: strconv.Itoa(port)})
+				}
+				if wantV6 {
+					binds = append(binds, nat.PortBinding{HostIP: "[::]", HostPort: strconv.Itoa(port)})
+				}
 
+				if wantTCP {
+					tcpPort := nat.Port(fmt.Sprintf("%d/tcp", port))
+					out[tcpPort] = append(out[tcpPort], binds...)
+				}
+				if wantUDP {
+					udpPort := nat.Port(fmt.Sprintf("%d/udp", port))
+					out[udpPort] = append(out[udpPort], binds...)
+				}
+			}
 		}
 	}
 
 	return out
 }
 
+// HostBindingPolicy controls how DockerBindings() treats the 127.0.0.1
+// allocation address, since "bind to loopback" means different things
+// depending on how the host's networking is set up.
+type HostBindingPolicy string
 
-// Returns the bindings for the server in a way that is supported correctly by Docker. This replaces
-// any reference to 127.0.0.1 with the IP of the pelican0 network interface which will allow the
-// server to operate on a local address while still being accessible by other containers.
-func (a *Allocations) DockerBindings() nat.PortMap {
-	iface := config.Get().Docker.Network.Interface
+const (
+	// HostBindingPolicyPassthrough leaves 127.0.0.1 bindings untouched.
+	HostBindingPolicyPassthrough HostBindingPolicy = "passthrough"
+	// HostBindingPolicyRewriteLoopbackToInterface is the historical default:
+	// 127.0.0.1 is rewritten to the configured pelican0 interface IP (or
+	// dropped entirely when ISPN is enabled).
+	HostBindingPolicyRewriteLoopbackToInterface HostBindingPolicy = "rewrite_loopback_to_interface"
+	// HostBindingPolicyForceLoopback rewrites every IPv4 binding to 127.0.0.1,
+	// regardless of what the allocation specified. IPv6 wildcard ([::])
+	// bindings are left as they are.
+	HostBindingPolicyForceLoopback HostBindingPolicy = "force_loopback"
+	// HostBindingPolicyForceAny rewrites every IPv4 binding to 0.0.0.0. IPv6
+	// wildcard ([::]) bindings are left as they are.
+	HostBindingPolicyForceAny HostBindingPolicy = "force_any"
+	// HostBindingPolicyAllowlist only allows bindings whose host IP appears in
+	// the configured allowlist; allocations pointing anywhere else are
+	// rejected at load time by Validate.
+	HostBindingPolicyAllowlist HostBindingPolicy = "allowlist"
+)
+
+// Validate checks every entry in Mappings is a well-formed IP address, and
+// against the configured docker.network.host_binding_policy, returning a
+// descriptive error for the first entry that isn't permitted. It should be
+// called whenever allocations are loaded from the panel so operators get an
+// immediate, actionable error instead of a server that silently fails to
+// bind — this matters even outside the allowlist policy, since setups like
+// Rancher Desktop/WSL only accept a narrow set of host IPs and a typo there
+// should be caught at load time rather than surfacing as an opaque Docker
+// error.
+func (a *Allocations) Validate(ctx context.Context, docker *client.Client) error {
+	if err := ValidateNetworkMode(ctx, docker, a.NetworkMode); err != nil {
+		return err
+	}
+
+	if err := a.IPAM.Validate(ctx, docker); err != nil {
+		return err
+	}
 
+	netCfg := config.Get().Docker.Network
+	policy := HostBindingPolicy(netCfg.HostBindingPolicy)
+
+	allowed := make(map[string]struct{}, len(netCfg.HostBindingAllowlist))
+	for _, ip := range netCfg.HostBindingAllowlist {
+		allowed[ip] = struct{}{}
+	}
+
+	for ip := range a.Mappings {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("environment: allocation host ip %q is not a valid IP address", ip)
+		}
+
+		if policy != HostBindingPolicyAllowlist {
+			continue
+		}
+		if _, ok := allowed[ip]; !ok {
+			return fmt.Errorf("environment: allocation host ip %q is not permitted by docker.network.host_binding_policy's allowlist", ip)
+		}
+	}
+
+	return nil
+}
+
+// Returns the bindings for the server in a way that is supported correctly by Docker. The exact
+// behavior here is controlled by the configured docker.network.host_binding_policy, since what
+// operators want to happen with a 127.0.0.1 allocation varies: some want it passed straight
+// through, some want it rewritten to the pelican0 interface IP, and some want it restricted to a
+// specific set of addresses entirely.
+func (a *Allocations) DockerBindings() nat.PortMap {
+	netCfg := config.Get().Docker.Network
 	out := a.Bindings()
-	// Loop over all the bindings for this container, and convert any that reference 127.0.0.1
-	// to use the pelican0 network interface IP, as that is the true local for what people are
-	// trying to do when creating servers.
-	for p, binds := range out {
-		for i, alloc := range binds {
-			if alloc.HostIP != "127.0.0.1" {
-				continue
-			}
 
-			// If using ISPN just delete the local allocation from the server.
-			if config.Get().Docker.Network.ISPN {
-				out[p] = append(out[p][:i], out[p][i+1:]...)
-			} else {
-				out[p][i] = nat.PortBinding{
-					HostIP:   iface,
-					HostPort: alloc.HostPort,
+	switch HostBindingPolicy(netCfg.HostBindingPolicy) {
+	case HostBindingPolicyForceLoopback:
+		rewriteHostIPs(out, func(string) string { return "127.0.0.1" })
+	case HostBindingPolicyForceAny:
+		rewriteHostIPs(out, func(string) string { return "0.0.0.0" })
+	case HostBindingPolicyPassthrough, HostBindingPolicyAllowlist:
+		// Nothing to rewrite; Validate() is responsible for rejecting
+		// disallowed addresses before we ever get here.
+	default:
+		// HostBindingPolicyRewriteLoopbackToInterface, and the zero value for
+		// backwards compatibility with configs predating this option.
+		iface := netCfg.Interface
+		for p, binds := range out {
+			for i, alloc := range binds {
+				if alloc.HostIP != "127.0.0.1" {
+					continue
+				}
+
+				// If using ISPN just delete the local allocation from the server.
+				if netCfg.ISPN {
+					out[p] = append(out[p][:i], out[p][i+1:]...)
+				} else {
+					out[p][i] = nat.PortBinding{
+						HostIP:   iface,
+						HostPort: alloc.HostPort,
+					}
 				}
 			}
 		}
@@ -107,6 +420,20 @@ func (a *Allocations) DockerBindings() nat.PortMap {
 	return out
 }
 
+// rewriteHostIPs replaces the HostIP of every binding in m using f, leaving
+// the IPv6 wildcard address alone since the force_loopback/force_any policies
+// only apply to the IPv4 side of a dual-stack binding.
+func rewriteHostIPs(m nat.PortMap, f func(string) string) {
+	for p, binds := range m {
+		for i, alloc := range binds {
+			if alloc.HostIP == "[::]" {
+				continue
+			}
+			m[p][i] = nat.PortBinding{HostIP: f(alloc.HostIP), HostPort: alloc.HostPort}
+		}
+	}
+}
+
 // Converts the server allocation mappings into a PortSet that can be understood
 // by Docker. This formatting is slightly different than "Bindings" as it should
 // return an empty struct rather than a binding.
@@ -0,0 +1,200 @@
+package environment
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+
+	"github.com/pelican-dev/wings/config"
+)
+
+// setNetworkConfig installs a minimal config.Configuration for the duration
+// of the calling test, since ipFamilyDefaults (and anything else touching
+// config.Get()) panics if no configuration has been loaded.
+func setNetworkConfig(t *testing.T, netCfg config.NetworkConfiguration) {
+	t.Helper()
+	config.Set(&config.Configuration{Docker: config.DockerConfiguration{Network: netCfg}})
+}
+
+func TestPortMappingUnmarshalJSON(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		want    PortMapping
+		wantErr bool
+	}{
+		{
+			name: "bare integer",
+			in:   `25565`,
+			want: PortMapping{Port: 25565, RangeEnd: 25565, Protocol: ProtocolBoth, HostIPFamily: HostIPFamilyDual},
+		},
+		{
+			name: "string port only",
+			in:   `"25565"`,
+			want: PortMapping{Port: 25565, RangeEnd: 25565, Protocol: ProtocolBoth, HostIPFamily: HostIPFamilyDual},
+		},
+		{
+			name: "string range with protocol",
+			in:   `"25565-25600/udp"`,
+			want: PortMapping{Port: 25565, RangeEnd: 25600, Protocol: ProtocolUDP, HostIPFamily: HostIPFamilyDual},
+		},
+		{
+			name:    "string inverted range is rejected",
+			in:      `"25600-25565/udp"`,
+			wantErr: true,
+		},
+		{
+			name: "object range",
+			in:   `{"range":[30000,30100],"proto":"udp"}`,
+			want: PortMapping{Port: 30000, RangeEnd: 30100, Protocol: ProtocolUDP, HostIPFamily: HostIPFamilyDual},
+		},
+		{
+			name:    "object inverted range is rejected",
+			in:      `{"range":[30100,30000]}`,
+			wantErr: true,
+		},
+		{
+			name:    "object port out of range is rejected",
+			in:      `{"port":70000}`,
+			wantErr: true,
+		},
+		{
+			name: "object dynamic request",
+			in:   `{"dynamic":{"proto":"tcp","count":4}}`,
+			want: PortMapping{Dynamic: &DynamicPortRequest{Protocol: ProtocolTCP, Count: 4}, Protocol: ProtocolBoth, HostIPFamily: HostIPFamilyDual},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got PortMapping
+			err := got.UnmarshalJSON([]byte(tc.in))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIpFamilyDefaults(t *testing.T) {
+	cases := []struct {
+		name           string
+		v4, v6         bool
+		wantV4, wantV6 bool
+	}{
+		{"neither set defaults to both enabled", false, false, true, true},
+		{"v4 only explicitly set", true, false, true, false},
+		{"v6 only explicitly set", false, true, false, true},
+		{"both explicitly set", true, true, true, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setNetworkConfig(t, config.NetworkConfiguration{IPv4Enabled: tc.v4, IPv6Enabled: tc.v6})
+
+			gotV4, gotV6 := ipFamilyDefaults()
+			if gotV4 != tc.wantV4 || gotV6 != tc.wantV6 {
+				t.Errorf("ipFamilyDefaults() = (%v, %v), want (%v, %v)", gotV4, gotV6, tc.wantV4, tc.wantV6)
+			}
+		})
+	}
+}
+
+func TestBindFamilies(t *testing.T) {
+	setNetworkConfig(t, config.NetworkConfiguration{}) // both enabled via the zero-value fallback
+
+	cases := []struct {
+		name           string
+		family         HostIPFamily
+		wantV4, wantV6 bool
+	}{
+		{"dual binds both", HostIPFamilyDual, true, true},
+		{"empty defaults to dual", "", true, true},
+		{"v4 only", HostIPFamilyV4, true, false},
+		{"v6 only", HostIPFamilyV6, false, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotV4, gotV6 := bindFamilies(PortMapping{HostIPFamily: tc.family})
+			if gotV4 != tc.wantV4 || gotV6 != tc.wantV6 {
+				t.Errorf("bindFamilies() = (%v, %v), want (%v, %v)", gotV4, gotV6, tc.wantV4, tc.wantV6)
+			}
+		})
+	}
+}
+
+func TestDockerBindingsHostBindingPolicy(t *testing.T) {
+	newLoopbackAllocation := func() *Allocations {
+		return &Allocations{
+			Mappings: map[string][]PortMapping{
+				"127.0.0.1": {{Port: 25565, RangeEnd: 25565, Protocol: ProtocolTCP, HostIPFamily: HostIPFamilyV4}},
+			},
+		}
+	}
+
+	cases := []struct {
+		name     string
+		netCfg   config.NetworkConfiguration
+		wantIP   string
+		wantGone bool
+	}{
+		{
+			name:   "passthrough leaves 127.0.0.1 alone",
+			netCfg: config.NetworkConfiguration{HostBindingPolicy: string(HostBindingPolicyPassthrough), IPv4Enabled: true},
+			wantIP: "127.0.0.1",
+		},
+		{
+			name:   "force_loopback rewrites to 127.0.0.1",
+			netCfg: config.NetworkConfiguration{HostBindingPolicy: string(HostBindingPolicyForceLoopback), IPv4Enabled: true},
+			wantIP: "127.0.0.1",
+		},
+		{
+			name:   "force_any rewrites to 0.0.0.0",
+			netCfg: config.NetworkConfiguration{HostBindingPolicy: string(HostBindingPolicyForceAny), IPv4Enabled: true},
+			wantIP: "0.0.0.0",
+		},
+		{
+			name:   "rewrite_loopback_to_interface rewrites to the configured interface",
+			netCfg: config.NetworkConfiguration{HostBindingPolicy: string(HostBindingPolicyRewriteLoopbackToInterface), Interface: "172.18.0.1", IPv4Enabled: true},
+			wantIP: "172.18.0.1",
+		},
+		{
+			name:     "rewrite_loopback_to_interface with ISPN drops the binding instead",
+			netCfg:   config.NetworkConfiguration{HostBindingPolicy: string(HostBindingPolicyRewriteLoopbackToInterface), ISPN: true, IPv4Enabled: true},
+			wantGone: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setNetworkConfig(t, tc.netCfg)
+
+			out := newLoopbackAllocation().DockerBindings()
+			binds, ok := out[nat.Port("25565/tcp")]
+			if tc.wantGone {
+				if ok && len(binds) != 0 {
+					t.Fatalf("expected the binding to be dropped, got %v", binds)
+				}
+				return
+			}
+
+			if !ok || len(binds) != 1 {
+				t.Fatalf("expected exactly one binding, got %v", binds)
+			}
+			if binds[0].HostIP != tc.wantIP {
+				t.Errorf("got host ip %q, want %q", binds[0].HostIP, tc.wantIP)
+			}
+		})
+	}
+}
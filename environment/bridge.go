@@ -0,0 +1,186 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// snatBridgePrefix is prepended to the DefaultMapping IP when naming the
+// dedicated bridge networks created for ForceOutgoingIP servers, so they are
+// easy to recognize (and garbage collect) alongside the regular pelican0
+// network. This is the Docker network name, which has no length limit; it is
+// NOT the kernel interface name iptables needs to match against (see ifName).
+const snatBridgePrefix = "pelican-snat-"
+
+// snatBridgeIfPrefix is prepended to the hashed outgoing IP when naming the
+// actual host-side bridge interface. Linux limits interface names to 15
+// characters (IFNAMSIZ - 1), which an IP address-based name would blow
+// through, so we hash it down instead.
+const snatBridgeIfPrefix = "psnat"
+
+// bridgeNetwork tracks a dedicated SNAT bridge and how many servers are
+// currently attached to it, so idle bridges can be torn down and concurrent
+// servers sharing the same outgoing IP can reuse a single network.
+type bridgeNetwork struct {
+	id         string
+	ifName     string
+	outgoingIp string
+	refs       int
+	lastUsed   time.Time
+}
+
+// BridgeManager creates and caches the dedicated bridge networks used to
+// implement ForceOutgoingIP. Docker doesn't let us SNAT a subset of
+// containers on a shared bridge to different addresses, so instead we create
+// one bridge per outgoing IP with `com.docker.network.bridge.host_binding_ipv4`
+// set, and add a MASQUERADE rule from that bridge's subnet to the allocation
+// IP so traffic leaving the container appears to originate from it.
+type BridgeManager struct {
+	mu       sync.Mutex
+	docker   *client.Client
+	networks map[string]*bridgeNetwork
+	idleTTL  time.Duration
+}
+
+// NewBridgeManager returns a BridgeManager that uses the provided Docker
+// client to create and inspect networks.
+func NewBridgeManager(docker *client.Client) *BridgeManager {
+	return &BridgeManager{
+		docker:   docker,
+		networks: make(map[string]*bridgeNetwork),
+		idleTTL:  5 * time.Minute,
+	}
+}
+
+// bridgeName returns the deterministic Docker network name used for a given
+// DefaultMapping IP so that multiple servers forcing their outgoing traffic
+// through the same IP can share a single bridge.
+func bridgeName(ip string) string {
+	return snatBridgePrefix + ip
+}
+
+// bridgeIfName returns the deterministic host-side interface name for a given
+// outgoing IP. It must stay within Linux's 15 character IFNAMSIZ limit, so
+// the IP is hashed rather than embedded directly; this is also the name
+// passed to iptables, which matches on the real kernel interface rather than
+// the Docker network name.
+func bridgeIfName(ip string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(ip))
+	return fmt.Sprintf("%s%08x", snatBridgeIfPrefix, h.Sum32())
+}
+
+// Acquire returns the ID of the dedicated SNAT bridge for the given
+// allocation, creating it (and the accompanying MASQUERADE rule) if it
+// doesn't already exist. The caller is expected to call Release once the
+// server is no longer attached to the network.
+func (m *BridgeManager) Acquire(ctx context.Context, a *Allocations) (string, error) {
+	if !a.ForceOutgoingIP {
+		return "", fmt.Errorf("environment: cannot acquire a SNAT bridge for an allocation with force_outgoing_ip disabled")
+	}
+
+	name := bridgeName(a.DefaultMapping.Ip)
+	ifName := bridgeIfName(a.DefaultMapping.Ip)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if bn, ok := m.networks[name]; ok {
+		bn.refs++
+		bn.lastUsed = time.Now()
+		return bn.id, nil
+	}
+
+	id, err := m.createBridge(ctx, name, ifName, a.DefaultMapping.Ip)
+	if err != nil {
+		return "", err
+	}
+
+	if err := applyMasqueradeRule(ifName, a.DefaultMapping.Ip); err != nil {
+		// The network was created successfully, but we could not install the
+		// MASQUERADE rule; remove the network rather than leaving a bridge
+		// around that silently doesn't SNAT anything.
+		_ = m.docker.NetworkRemove(ctx, id)
+		return "", fmt.Errorf("environment: failed to apply SNAT rule for %s: %w", name, err)
+	}
+
+	m.networks[name] = &bridgeNetwork{id: id, ifName: ifName, outgoingIp: a.DefaultMapping.Ip, refs: 1, lastUsed: time.Now()}
+
+	return id, nil
+}
+
+// createBridge creates the dedicated bridge network for the given outgoing
+// IP, setting host_binding_ipv4 so ports published on the bridge default to
+// that address; the outbound source address is left to the SNAT rule
+// installed by applyMasqueradeRule. ifName is pinned
+// explicitly via com.docker.network.bridge.name so the resulting kernel
+// interface matches what applyMasqueradeRule targets, rather than whatever
+// name Docker would have otherwise generated.
+func (m *BridgeManager) createBridge(ctx context.Context, name, ifName, outgoingIp string) (string, error) {
+	resp, err := m.docker.NetworkCreate(ctx, name, network.CreateOptions{
+		Driver:     "bridge",
+		Attachable: true,
+		Options: map[string]string{
+			"com.docker.network.bridge.name":              ifName,
+			"com.docker.network.bridge.host_binding_ipv4": outgoingIp,
+			"com.docker.network.bridge.enable_icc":        "true",
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("environment: failed to create SNAT bridge %s: %w", name, err)
+	}
+
+	return resp.ID, nil
+}
+
+// Release decrements the reference count for the bridge backing the given
+// allocation. The network itself isn't removed immediately; it is left to
+// GC to reap once it has been idle for longer than idleTTL, so a server
+// restart doesn't cause a create/destroy cycle on every boot.
+func (m *BridgeManager) Release(a *Allocations) {
+	if !a.ForceOutgoingIP {
+		return
+	}
+
+	name := bridgeName(a.DefaultMapping.Ip)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bn, ok := m.networks[name]
+	if !ok {
+		return
+	}
+
+	bn.refs--
+	bn.lastUsed = time.Now()
+}
+
+// GC removes any SNAT bridges that have had no attached servers for longer
+// than the configured idle TTL, along with their MASQUERADE rule. It should
+// be called periodically (e.g. alongside the existing Docker environment
+// cleanup pass).
+func (m *BridgeManager) GC(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, bn := range m.networks {
+		if bn.refs > 0 || time.Since(bn.lastUsed) < m.idleTTL {
+			continue
+		}
+
+		if err := m.docker.NetworkRemove(ctx, bn.id); err != nil {
+			return fmt.Errorf("environment: failed to remove idle SNAT bridge %s: %w", name, err)
+		}
+		removeMasqueradeRule(bn.ifName, bn.outgoingIp)
+		delete(m.networks, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package environment
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBridgeIfNameFitsLinuxLimit(t *testing.T) {
+	ips := []string{"192.168.1.100", "10.0.0.1", "203.0.113.255", "2001:db8::1"}
+
+	for _, ip := range ips {
+		name := bridgeIfName(ip)
+		if len(name) > 15 {
+			t.Errorf("bridgeIfName(%q) = %q, which is %d chars; Linux interface names must be <= 15", ip, name, len(name))
+		}
+		if !strings.HasPrefix(name, snatBridgeIfPrefix) {
+			t.Errorf("bridgeIfName(%q) = %q, expected prefix %q", ip, name, snatBridgeIfPrefix)
+		}
+	}
+}
+
+func TestBridgeIfNameDeterministicAndDistinct(t *testing.T) {
+	a := bridgeIfName("192.168.1.100")
+	b := bridgeIfName("192.168.1.100")
+	if a != b {
+		t.Errorf("bridgeIfName should be deterministic, got %q and %q for the same input", a, b)
+	}
+
+	c := bridgeIfName("192.168.1.101")
+	if a == c {
+		t.Errorf("bridgeIfName(%q) and bridgeIfName(%q) collided on %q", "192.168.1.100", "192.168.1.101", a)
+	}
+}
+
+func TestMasqueradeRuleArgsMatchForApplyAndRemove(t *testing.T) {
+	applyArgs := masqueradeRuleArgs("-A", "psnatdeadbeef", "203.0.113.10")
+	removeArgs := masqueradeRuleArgs("-D", "psnatdeadbeef", "203.0.113.10")
+
+	if len(applyArgs) != len(removeArgs) {
+		t.Fatalf("apply and remove rule args differ in length: %v vs %v", applyArgs, removeArgs)
+	}
+
+	for i := range applyArgs {
+		// The action itself ("-A" vs "-D") is expected to differ; everything
+		// else must match exactly or iptables -D won't find the rule to delete.
+		if i == 1 {
+			continue
+		}
+		if applyArgs[i] != removeArgs[i] {
+			t.Errorf("rule spec mismatch at index %d: apply=%q remove=%q (full: %v vs %v)", i, applyArgs[i], removeArgs[i], applyArgs, removeArgs)
+		}
+	}
+
+	joined := strings.Join(applyArgs, " ")
+	if !strings.Contains(joined, "-o psnatdeadbeef") {
+		t.Errorf("expected rule to match on the bridge interface, got: %s", joined)
+	}
+	if !strings.Contains(joined, "--to-source 203.0.113.10") {
+		t.Errorf("expected rule to SNAT to the outgoing IP, got: %s", joined)
+	}
+}
@@ -0,0 +1,94 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// NetworkPlan is the networking-related subset of a container's create
+// configuration, assembled from an Allocations by PlanNetworking. The Docker
+// environment's container create path applies this alongside the rest of its
+// HostConfig/NetworkingConfig when starting a server.
+type NetworkPlan struct {
+	// ExposedPorts and PortBindings are what Bindings()/DockerBindings()
+	// already produced; PlanNetworking exists so the remaining networking
+	// concerns (ForceOutgoingIP, NetworkMode, IPAM) can be resolved in one
+	// place alongside them.
+	ExposedPorts nat.PortSet
+	PortBindings nat.PortMap
+	// NetworkID, when non-empty, is the ID of the dedicated SNAT bridge the
+	// container should be attached to instead of the default pelican0
+	// network.
+	NetworkID string
+	// EndpointsConfig carries the pelican0 IPAM settings (fixed addresses,
+	// link-local IPs) to pass as NetworkingConfig.EndpointsConfig when
+	// creating the container; nil when no IPAM was requested.
+	EndpointsConfig map[string]*network.EndpointSettings
+	// Release must be called once the container created from this plan is
+	// torn down, so a ForceOutgoingIP bridge's reference count stays
+	// accurate.
+	Release func()
+	// AssignedDynamicPorts lists every port assigned from pool to satisfy a
+	// "dynamic" mapping entry, whether reused from persisted or newly drawn
+	// (request-chunk0-4). The caller is
+	// responsible for persisting these back to the server's state file and
+	// passing them back in as persisted on the next call, so a restart
+	// doesn't reshuffle the assignment.
+	AssignedDynamicPorts []int
+}
+
+// PlanNetworking validates the allocation (network mode, IPAM, host binding
+// policy), resolves any dynamic mapping entries against pool, resolves
+// ForceOutgoingIP into a concrete bridge network (via bridges), and returns
+// everything the Docker environment's container create call needs to wire up
+// networking for this allocation.
+//
+// owner identifies the server for the purposes of the dynamic port pool
+// (typically its UUID); persisted is the set of ports that were assigned to
+// owner the last time this ran, as read back from the server's state file, so
+// dynamic ports stay stable across restarts.
+func (a *Allocations) PlanNetworking(ctx context.Context, docker *client.Client, bridges *BridgeManager, pool *PortPool, owner string, persisted []int) (*NetworkPlan, error) {
+	if err := a.Validate(ctx, docker); err != nil {
+		return nil, err
+	}
+
+	var assigned []int
+	if pool != nil {
+		var err error
+		assigned, err = a.ResolveDynamic(pool, owner, persisted)
+		if err != nil {
+			return nil, err
+		}
+	} else if a.HasDynamicMappings() {
+		return nil, fmt.Errorf("environment: allocation requests dynamic ports but no docker.network.dynamic_port_pool is configured")
+	}
+
+	plan := &NetworkPlan{
+		AssignedDynamicPorts: assigned,
+		ExposedPorts:         a.Exposed(),
+		PortBindings:         a.DockerBindings(),
+		Release:              func() {},
+	}
+
+	if ep := a.IPAM.EndpointSettings(); ep != nil {
+		plan.EndpointsConfig = map[string]*network.EndpointSettings{pelicanNetworkName: ep}
+	}
+
+	if !a.ForceOutgoingIP {
+		return plan, nil
+	}
+
+	id, err := bridges.Acquire(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.NetworkID = id
+	plan.Release = func() { bridges.Release(a) }
+
+	return plan, nil
+}
@@ -0,0 +1,141 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+
+	"github.com/pelican-dev/wings/config"
+)
+
+// pelicanNetworkName is the Docker network every server is attached to by
+// default, and the one IPAM addresses are validated and checked for
+// collisions against.
+const pelicanNetworkName = "pelican0"
+
+// IPAM lets the panel pin a server to a stable address on the pelican0
+// network, or hand it link-local addresses for service discovery, instead of
+// relying on whatever Docker's built-in IPAM allocator hands out. This
+// mirrors Docker's own --link-local-ip and EndpointIPAMConfig.
+type IPAM struct {
+	IPv4Address  string   `json:"ipv4_address,omitempty"`
+	IPv6Address  string   `json:"ipv6_address,omitempty"`
+	LinkLocalIPs []string `json:"link_local_ips,omitempty"`
+}
+
+// IsEmpty reports whether no addresses were requested, in which case Docker's
+// default IPAM allocator should be left alone.
+func (i *IPAM) IsEmpty() bool {
+	return i == nil || (i.IPv4Address == "" && i.IPv6Address == "" && len(i.LinkLocalIPs) == 0)
+}
+
+// Validate checks that every requested address is well-formed, that the
+// fixed IPv4/IPv6 addresses fall within the pelican0 network's configured
+// subnet, and that neither address is already held by another endpoint on
+// pelican0. Link-local addresses are exempt from both the subnet and
+// collision checks since by definition they don't belong to the network.
+func (i *IPAM) Validate(ctx context.Context, docker *client.Client) error {
+	if i.IsEmpty() {
+		return nil
+	}
+
+	netCfg := config.Get().Docker.Network
+
+	if i.IPv4Address != "" {
+		if err := validateWithinSubnet(i.IPv4Address, netCfg.Interfaces.V4.Subnet); err != nil {
+			return fmt.Errorf("environment: ipam.ipv4_address: %w", err)
+		}
+	}
+	if i.IPv6Address != "" {
+		if err := validateWithinSubnet(i.IPv6Address, netCfg.Interfaces.V6.Subnet); err != nil {
+			return fmt.Errorf("environment: ipam.ipv6_address: %w", err)
+		}
+	}
+	for _, ip := range i.LinkLocalIPs {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("environment: ipam.link_local_ips: %q is not a valid IP address", ip)
+		}
+	}
+
+	return i.checkCollisions(ctx, docker)
+}
+
+// checkCollisions inspects the pelican0 network and rejects the requested
+// fixed addresses if either is already held by an existing endpoint. It's a
+// best-effort check performed at allocation time; Docker itself will also
+// refuse to start a container that asks for an address already in use.
+func (i *IPAM) checkCollisions(ctx context.Context, docker *client.Client) error {
+	insp, err := docker.NetworkInspect(ctx, pelicanNetworkName, network.InspectOptions{})
+	if err != nil {
+		return fmt.Errorf("environment: ipam: failed to inspect %s to check for address collisions: %w", pelicanNetworkName, err)
+	}
+
+	for _, ep := range insp.Containers {
+		if i.IPv4Address != "" && addressInCIDRMatches(ep.IPv4Address, i.IPv4Address) {
+			return fmt.Errorf("environment: ipam.ipv4_address %q is already in use by another endpoint on %s", i.IPv4Address, pelicanNetworkName)
+		}
+		if i.IPv6Address != "" && addressInCIDRMatches(ep.IPv6Address, i.IPv6Address) {
+			return fmt.Errorf("environment: ipam.ipv6_address %q is already in use by another endpoint on %s", i.IPv6Address, pelicanNetworkName)
+		}
+	}
+
+	return nil
+}
+
+// addressInCIDRMatches reports whether cidr (as reported by Docker, e.g.
+// "172.20.0.5/16") has the same host address as ip.
+func addressInCIDRMatches(cidr, ip string) bool {
+	host, _, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	return host.String() == ip
+}
+
+// validateWithinSubnet confirms ip parses and falls within subnet (a CIDR).
+// An empty subnet means the pelican0 network hasn't been configured with a
+// fixed subnet (it's using Docker's default IPAM driver), in which case we
+// can't meaningfully check containment and only validate the address itself.
+func validateWithinSubnet(ip, subnet string) error {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return fmt.Errorf("%q is not a valid IP address", ip)
+	}
+
+	if subnet == "" {
+		return nil
+	}
+
+	_, subnetNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return fmt.Errorf("configured subnet %q is invalid: %w", subnet, err)
+	}
+	if !subnetNet.Contains(parsed) {
+		return fmt.Errorf("%q does not fall within the pelican0 subnet %s", ip, subnet)
+	}
+
+	return nil
+}
+
+// EndpointSettings builds the Docker EndpointSettings for the pelican0
+// network, populating IPAMConfig from the requested addresses so the Docker
+// environment can attach it under NetworkingConfig.EndpointsConfig when
+// creating the container. It returns nil if no addresses were requested, in
+// which case the caller should omit IPAMConfig entirely and let Docker's
+// allocator pick an address as it always has.
+func (i *IPAM) EndpointSettings() *network.EndpointSettings {
+	if i.IsEmpty() {
+		return nil
+	}
+
+	return &network.EndpointSettings{
+		IPAMConfig: &network.EndpointIPAMConfig{
+			IPv4Address:  i.IPv4Address,
+			IPv6Address:  i.IPv6Address,
+			LinkLocalIPs: i.LinkLocalIPs,
+		},
+	}
+}
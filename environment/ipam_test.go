@@ -0,0 +1,89 @@
+package environment
+
+import "testing"
+
+func TestIPAMIsEmpty(t *testing.T) {
+	cases := []struct {
+		name string
+		ipam IPAM
+		want bool
+	}{
+		{"zero value", IPAM{}, true},
+		{"ipv4 only", IPAM{IPv4Address: "172.20.0.5"}, false},
+		{"ipv6 only", IPAM{IPv6Address: "fd00::5"}, false},
+		{"link-local only", IPAM{LinkLocalIPs: []string{"169.254.0.5"}}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.ipam.IsEmpty(); got != tc.want {
+				t.Errorf("IsEmpty() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateWithinSubnet(t *testing.T) {
+	cases := []struct {
+		name    string
+		ip      string
+		subnet  string
+		wantErr bool
+	}{
+		{"valid address within subnet", "172.20.0.5", "172.20.0.0/16", false},
+		{"address outside subnet", "10.0.0.5", "172.20.0.0/16", true},
+		{"invalid address", "not-an-ip", "172.20.0.0/16", true},
+		{"invalid subnet", "172.20.0.5", "not-a-cidr", true},
+		{"empty subnet still requires a valid ip", "not-an-ip", "", true},
+		{"empty subnet skips containment check", "172.20.0.5", "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateWithinSubnet(tc.ip, tc.subnet)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validateWithinSubnet(%q, %q) error = %v, wantErr %v", tc.ip, tc.subnet, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddressInCIDRMatches(t *testing.T) {
+	cases := []struct {
+		name string
+		cidr string
+		ip   string
+		want bool
+	}{
+		{"matching host", "172.20.0.5/16", "172.20.0.5", true},
+		{"different host same subnet", "172.20.0.6/16", "172.20.0.5", false},
+		{"unparseable cidr", "not-a-cidr", "172.20.0.5", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := addressInCIDRMatches(tc.cidr, tc.ip); got != tc.want {
+				t.Errorf("addressInCIDRMatches(%q, %q) = %v, want %v", tc.cidr, tc.ip, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEndpointSettings(t *testing.T) {
+	empty := IPAM{}
+	if ep := empty.EndpointSettings(); ep != nil {
+		t.Errorf("expected nil EndpointSettings for an empty IPAM, got %+v", ep)
+	}
+
+	i := IPAM{IPv4Address: "172.20.0.5", LinkLocalIPs: []string{"169.254.0.5"}}
+	ep := i.EndpointSettings()
+	if ep == nil || ep.IPAMConfig == nil {
+		t.Fatalf("expected a populated EndpointSettings, got %+v", ep)
+	}
+	if ep.IPAMConfig.IPv4Address != i.IPv4Address {
+		t.Errorf("got IPv4Address %q, want %q", ep.IPAMConfig.IPv4Address, i.IPv4Address)
+	}
+	if len(ep.IPAMConfig.LinkLocalIPs) != 1 || ep.IPAMConfig.LinkLocalIPs[0] != "169.254.0.5" {
+		t.Errorf("got LinkLocalIPs %v, want [169.254.0.5]", ep.IPAMConfig.LinkLocalIPs)
+	}
+}
@@ -0,0 +1,53 @@
+package environment
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// masqueradeComment tags every rule this package installs so removeMasqueradeRule
+// (and an operator running `iptables -t nat -L -v`) can tell at a glance which
+// rules belong to a ForceOutgoingIP bridge.
+func masqueradeComment(ifName string) string {
+	return fmt.Sprintf("pelican-snat:%s", ifName)
+}
+
+// masqueradeRuleArgs builds the iptables argument list for a bridge's
+// MASQUERADE rule. ifName must be the real host-side kernel interface name
+// (see bridgeIfName), not the Docker network name, since that's what `-o`
+// matches against. It's factored out from applyMasqueradeRule/
+// removeMasqueradeRule so both install and delete build the exact same rule
+// spec, which iptables requires for -D to find a match.
+func masqueradeRuleArgs(action, ifName, outgoingIp string) []string {
+	return []string{
+		"-t", "nat",
+		action, "POSTROUTING",
+		"-o", ifName,
+		"-j", "SNAT",
+		"--to-source", outgoingIp,
+		"-m", "comment", "--comment", masqueradeComment(ifName),
+	}
+}
+
+// applyMasqueradeRule installs a POSTROUTING SNAT rule that rewrites
+// traffic leaving the given bridge interface so it appears to originate from
+// outgoingIp. Docker's `host_binding_ipv4` option controls which address the
+// bridge itself binds published ports to, but it does not affect the source
+// address containers use for outbound connections, hence the explicit rule.
+func applyMasqueradeRule(ifName, outgoingIp string) error {
+	args := masqueradeRuleArgs("-A", ifName, outgoingIp)
+	if out, err := exec.Command("iptables", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("iptables %v: %w: %s", args, err, out)
+	}
+
+	return nil
+}
+
+// removeMasqueradeRule deletes the MASQUERADE rule previously installed by
+// applyMasqueradeRule for the given bridge interface. Errors are deliberately
+// discarded here, so GC never sees them, since a bridge that is already gone may have
+// taken its rule with it, and we don't want a stale rule to block cleanup of
+// the rest.
+func removeMasqueradeRule(ifName, outgoingIp string) {
+	_ = exec.Command("iptables", masqueradeRuleArgs("-D", ifName, outgoingIp)...).Run()
+}
@@ -0,0 +1,98 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// NetworkMode selects how a server's container is attached to the network
+// stack. The default, bridge, is the only mode that makes port bindings and
+// Allocations.Mappings meaningful. host and none hand networking off to the
+// host or disable it entirely; container:<uuid> shares another server's
+// netns; anything else is treated as the name of a user-defined Docker
+// network the server should join instead of the default pelican0 bridge.
+type NetworkMode string
+
+const (
+	// NetworkModeBridge publishes Mappings on the pelican0 bridge network.
+	// This is the default when NetworkMode is left empty.
+	NetworkModeBridge NetworkMode = "bridge"
+	// NetworkModeHost shares the host's network namespace directly; no ports
+	// are published since the container already sees every host interface.
+	NetworkModeHost NetworkMode = "host"
+	// NetworkModeNone disables networking for the container entirely.
+	NetworkModeNone NetworkMode = "none"
+)
+
+// networkModeContainerPrefix identifies the "container:<uuid>" form of
+// NetworkMode, which attaches a server to another server's network namespace
+// (e.g. a Geyser proxy sharing a Minecraft server's netns).
+const networkModeContainerPrefix = "container:"
+
+// IsContainer reports whether the mode is "container:<uuid>", and returns the
+// referenced server UUID.
+func (m NetworkMode) IsContainer() (string, bool) {
+	id, ok := strings.CutPrefix(string(m), networkModeContainerPrefix)
+	return id, ok
+}
+
+// publishesPorts reports whether this mode publishes any ports at all. Host,
+// none, and container modes all make Allocations.Mappings meaningless: host
+// already exposes every port on the machine, none exposes nothing, and
+// container mode means the referenced server's ports are what's published.
+func (m NetworkMode) publishesPorts() bool {
+	switch m {
+	case NetworkModeHost, NetworkModeNone:
+		return false
+	default:
+		if _, ok := m.IsContainer(); ok {
+			return false
+		}
+		return true
+	}
+}
+
+// ServerLookup is used to validate "container:<uuid>" NetworkMode values
+// against the servers actually present on this node. It is set by the server
+// manager during startup; environment can't import that package directly
+// without creating an import cycle.
+var ServerLookup func(uuid string) (running bool, exists bool)
+
+// ValidateNetworkMode checks that mode is well-formed: for container mode,
+// that the referenced server exists and is running on this node; for a named
+// network, that it actually exists in Docker.
+func ValidateNetworkMode(ctx context.Context, docker *client.Client, mode NetworkMode) error {
+	switch mode {
+	case "", NetworkModeBridge, NetworkModeHost, NetworkModeNone:
+		return nil
+	}
+
+	if id, ok := mode.IsContainer(); ok {
+		if ServerLookup == nil {
+			return fmt.Errorf("environment: cannot validate network mode %q: no server lookup configured", mode)
+		}
+
+		running, exists := ServerLookup(id)
+		if !exists {
+			return fmt.Errorf("environment: network mode %q references a server that does not exist on this node", mode)
+		}
+		if !running {
+			return fmt.Errorf("environment: network mode %q references server %s, which is not currently running", mode, id)
+		}
+
+		return nil
+	}
+
+	// Anything else is taken to be the name of a user-defined network; make
+	// sure it actually exists rather than letting container creation fail
+	// later with a much less obvious Docker error.
+	if _, err := docker.NetworkInspect(ctx, string(mode), network.InspectOptions{}); err != nil {
+		return fmt.Errorf("environment: network mode %q does not reference a network Docker knows about: %w", mode, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package environment
+
+import "testing"
+
+func TestNetworkModeIsContainer(t *testing.T) {
+	cases := []struct {
+		mode   NetworkMode
+		wantID string
+		wantOK bool
+	}{
+		{NetworkModeBridge, "", false},
+		{NetworkModeHost, "", false},
+		{NetworkModeNone, "", false},
+		{"pelican0", "", false},
+		{"container:3fa9c1d2-...-uuid", "3fa9c1d2-...-uuid", true},
+		{"container:", "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			id, ok := tc.mode.IsContainer()
+			if ok != tc.wantOK || id != tc.wantID {
+				t.Errorf("IsContainer() = (%q, %v), want (%q, %v)", id, ok, tc.wantID, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestNetworkModePublishesPorts(t *testing.T) {
+	cases := []struct {
+		mode NetworkMode
+		want bool
+	}{
+		{"", true},
+		{NetworkModeBridge, true},
+		{"pelican0", true},
+		{NetworkModeHost, false},
+		{NetworkModeNone, false},
+		{"container:some-uuid", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			if got := tc.mode.publishesPorts(); got != tc.want {
+				t.Errorf("publishesPorts() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateNetworkModeContainer(t *testing.T) {
+	defer func() { ServerLookup = nil }()
+
+	t.Run("no lookup configured", func(t *testing.T) {
+		ServerLookup = nil
+		if err := ValidateNetworkMode(nil, nil, "container:some-uuid"); err == nil {
+			t.Error("expected an error when no ServerLookup is configured")
+		}
+	})
+
+	t.Run("referenced server does not exist", func(t *testing.T) {
+		ServerLookup = func(uuid string) (bool, bool) { return false, false }
+		if err := ValidateNetworkMode(nil, nil, "container:some-uuid"); err == nil {
+			t.Error("expected an error for a server that doesn't exist")
+		}
+	})
+
+	t.Run("referenced server exists but isn't running", func(t *testing.T) {
+		ServerLookup = func(uuid string) (bool, bool) { return false, true }
+		if err := ValidateNetworkMode(nil, nil, "container:some-uuid"); err == nil {
+			t.Error("expected an error for a server that isn't running")
+		}
+	})
+
+	t.Run("referenced server exists and is running", func(t *testing.T) {
+		ServerLookup = func(uuid string) (bool, bool) { return true, true }
+		if err := ValidateNetworkMode(nil, nil, "container:some-uuid"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestValidateNetworkModeBuiltins(t *testing.T) {
+	for _, mode := range []NetworkMode{"", NetworkModeBridge, NetworkModeHost, NetworkModeNone} {
+		t.Run(string(mode), func(t *testing.T) {
+			if err := ValidateNetworkMode(nil, nil, mode); err != nil {
+				t.Errorf("unexpected error for built-in mode %q: %v", mode, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package environment
+
+import (
+	"fmt"
+	"sync"
+)
+
+// PortPool hands out free ports from a configured range for dynamic
+// allocations (docker.network.dynamic_port_pool), mirroring Docker's
+// historical portRangeStart/portRangeEnd allocator. A single process-wide
+// pool is shared across every server on the node so two dynamic requests
+// never collide.
+type PortPool struct {
+	mu    sync.Mutex
+	start int
+	end   int
+	// used maps a reserved port to the identifier (typically the server UUID)
+	// that holds it, so a server's existing reservation can be released or
+	// reused across restarts.
+	used map[int]string
+}
+
+// NewPortPool returns a PortPool that allocates ports in the inclusive
+// [start, end] range.
+func NewPortPool(start, end int) *PortPool {
+	return &PortPool{start: start, end: end, used: make(map[int]string)}
+}
+
+// Reserve assigns count ports to owner. Ports already held by owner (passed in
+// as persisted, typically read back from the server's state file) are
+// reused first so a restart doesn't reshuffle the assignment; only the
+// shortfall is drawn from the free pool.
+func (p *PortPool) Reserve(owner string, count int, persisted []int) ([]int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	assigned := make([]int, 0, count)
+	for _, port := range persisted {
+		if len(assigned) >= count {
+			break
+		}
+		if port < p.start || port > p.end {
+			continue
+		}
+		if holder, ok := p.used[port]; ok && holder != owner {
+			continue
+		}
+		p.used[port] = owner
+		assigned = append(assigned, port)
+	}
+
+	for port := p.start; len(assigned) < count && port <= p.end; port++ {
+		if _, ok := p.used[port]; ok {
+			continue
+		}
+		p.used[port] = owner
+		assigned = append(assigned, port)
+	}
+
+	if len(assigned) < count {
+		// Roll back the partial reservation; a caller that can't get the full
+		// count it asked for almost certainly can't make use of a partial one.
+		for _, port := range assigned {
+			delete(p.used, port)
+		}
+		return nil, fmt.Errorf("environment: dynamic port pool %d-%d has no %d free port(s) left", p.start, p.end, count)
+	}
+
+	return assigned, nil
+}
+
+// Release frees every port held by owner.
+func (p *PortPool) Release(owner string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for port, holder := range p.used {
+		if holder == owner {
+			delete(p.used, port)
+		}
+	}
+}
+
+// ResolveDynamic replaces every dynamic mapping entry, under every IP in
+// Mappings, with concrete PortMapping entries drawn from pool, reusing the
+// ports in persisted (as previously written to the server's state file) where
+// possible. The returned slice holds every assigned port, reused or newly
+// drawn, and should be persisted back by the caller so the next restart is
+// stable.
+//
+// A server can have more than one dynamic entry (e.g. a tcp block and a udp
+// block), and each one calls pool.Reserve independently. remaining tracks
+// which of the persisted ports are still unclaimed as that happens, so a
+// second dynamic entry doesn't get handed the exact same persisted ports the
+// first one already reused — Reserve's own bookkeeping only rejects a
+// persisted port held by a *different* owner, which doesn't help here since
+// every dynamic entry in this pass shares the same owner.
+func (a *Allocations) ResolveDynamic(pool *PortPool, owner string, persisted []int) ([]int, error) {
+	var assignedAll []int
+	remaining := append([]int(nil), persisted...)
+
+	for ip, mappings := range a.Mappings {
+		resolved := make([]PortMapping, 0, len(mappings))
+		for _, mapping := range mappings {
+			if mapping.Dynamic == nil {
+				resolved = append(resolved, mapping)
+				continue
+			}
+
+			ports, err := pool.Reserve(owner, mapping.Dynamic.Count, remaining)
+			if err != nil {
+				return nil, err
+			}
+			remaining = withoutPorts(remaining, ports)
+
+			for _, port := range ports {
+				resolved = append(resolved, PortMapping{
+					Port:         port,
+					RangeEnd:     port,
+					Protocol:     mapping.Dynamic.Protocol,
+					HostIPFamily: mapping.HostIPFamily,
+				})
+			}
+			assignedAll = append(assignedAll, ports...)
+		}
+		a.Mappings[ip] = resolved
+	}
+
+	return assignedAll, nil
+}
+
+// withoutPorts returns persisted with every port in claimed stripped out.
+func withoutPorts(persisted, claimed []int) []int {
+	if len(claimed) == 0 {
+		return persisted
+	}
+
+	skip := make(map[int]struct{}, len(claimed))
+	for _, port := range claimed {
+		skip[port] = struct{}{}
+	}
+
+	out := make([]int, 0, len(persisted))
+	for _, port := range persisted {
+		if _, ok := skip[port]; ok {
+			continue
+		}
+		out = append(out, port)
+	}
+
+	return out
+}
+
+// HasDynamicMappings reports whether any Mappings entry requests dynamic port
+// assignment, i.e. whether ResolveDynamic must be called (with a non-nil
+// pool) before Bindings()/DockerBindings() will see every allocated port.
+func (a *Allocations) HasDynamicMappings() bool {
+	for _, mappings := range a.Mappings {
+		for _, mapping := range mappings {
+			if mapping.Dynamic != nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
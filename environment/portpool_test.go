@@ -0,0 +1,86 @@
+package environment
+
+import "testing"
+
+func TestPortPoolReserveReusesPersistedPorts(t *testing.T) {
+	pool := NewPortPool(40000, 40010)
+
+	got, err := pool.Reserve("server-a", 2, []int{40005, 40006})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0] != 40005 || got[1] != 40006 {
+		t.Fatalf("expected the persisted ports to be reused, got %v", got)
+	}
+}
+
+func TestPortPoolReserveFailsWhenExhausted(t *testing.T) {
+	pool := NewPortPool(40000, 40001)
+
+	if _, err := pool.Reserve("server-a", 3, nil); err == nil {
+		t.Fatal("expected an error when the pool can't satisfy the requested count")
+	}
+
+	// A failed reservation should roll back, leaving the pool untouched.
+	got, err := pool.Reserve("server-b", 2, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 ports, got %v", got)
+	}
+}
+
+// TestResolveDynamicDoesNotDoubleAssignPersistedPorts is a regression test
+// for a bug where a server with two dynamic mapping entries sharing the same
+// persisted port list (e.g. a tcp block and a udp block) was handed the
+// exact same ports for both, silently losing one allocation.
+func TestResolveDynamicDoesNotDoubleAssignPersistedPorts(t *testing.T) {
+	pool := NewPortPool(40000, 40010)
+
+	a := &Allocations{
+		Mappings: map[string][]PortMapping{
+			"0.0.0.0": {
+				{Dynamic: &DynamicPortRequest{Protocol: ProtocolTCP, Count: 2}},
+				{Dynamic: &DynamicPortRequest{Protocol: ProtocolUDP, Count: 2}},
+			},
+		},
+	}
+
+	assigned, err := a.ResolveDynamic(pool, "server-a", []int{40000, 40001, 40002, 40003})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(assigned) != 4 {
+		t.Fatalf("expected 4 distinct ports to be assigned, got %v", assigned)
+	}
+
+	seen := make(map[int]struct{}, len(assigned))
+	for _, port := range assigned {
+		if _, ok := seen[port]; ok {
+			t.Fatalf("port %d was assigned to more than one dynamic entry: %v", port, assigned)
+		}
+		seen[port] = struct{}{}
+	}
+
+	resolved := a.Mappings["0.0.0.0"]
+	if len(resolved) != 4 {
+		t.Fatalf("expected 4 resolved mapping entries, got %d: %+v", len(resolved), resolved)
+	}
+}
+
+func TestHasDynamicMappings(t *testing.T) {
+	withDynamic := &Allocations{Mappings: map[string][]PortMapping{
+		"0.0.0.0": {{Dynamic: &DynamicPortRequest{Count: 1}}},
+	}}
+	if !withDynamic.HasDynamicMappings() {
+		t.Error("expected HasDynamicMappings to report true")
+	}
+
+	withoutDynamic := &Allocations{Mappings: map[string][]PortMapping{
+		"0.0.0.0": {{Port: 25565, RangeEnd: 25565}},
+	}}
+	if withoutDynamic.HasDynamicMappings() {
+		t.Error("expected HasDynamicMappings to report false")
+	}
+}